@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultHistoryLimit = 10
+
+// CommandHandler handles one bot command. args is the message text with the
+// command token stripped; reply sends a message back to the chat the
+// command came from.
+type CommandHandler func(ctx context.Context, update TelegramUpdate, args string, reply func(text, parseMode string))
+
+// commands maps a command token (including the leading "/") to its handler.
+// Registered at startup (see init below) so the bot can be extended without
+// touching the webhook or poll-loop dispatch code.
+var commands = map[string]CommandHandler{}
+
+func init() {
+	commands["/start"] = handleStartCommand
+	commands["/help"] = handleHelpCommand
+	commands["/status"] = handleStatusCommand
+	commands["/post"] = handlePostCommand
+	commands["/dryrun"] = handleDryRunCommand
+	commands["/groupid"] = handleGroupIDCommand
+	commands["/history"] = handleHistoryCommand
+}
+
+// stats tracks lightweight runtime counters surfaced by /status. The last
+// posted ID itself comes from the store (see handleStatusCommand) so it
+// survives a restart instead of resetting with these process-lifetime
+// counters.
+var stats = struct {
+	mu            sync.Mutex
+	startedAt     time.Time
+	fetchErrors   int
+	hashtagErrors int
+	twitterErrors int
+}{startedAt: time.Now()}
+
+func recordFetchError()   { stats.mu.Lock(); stats.fetchErrors++; stats.mu.Unlock() }
+func recordHashtagError() { stats.mu.Lock(); stats.hashtagErrors++; stats.mu.Unlock() }
+func recordTwitterError() { stats.mu.Lock(); stats.twitterErrors++; stats.mu.Unlock() }
+
+// dispatchMessage routes an incoming update to its registered command
+// handler based on the first whitespace-separated token, falling back to
+// treating the whole text as an article ID for backwards compatibility.
+func dispatchMessage(ctx context.Context, update TelegramUpdate) {
+	msg := update.Message
+	reply := func(text, parseMode string) {
+		sendMessage(ctx, strconv.FormatInt(msg.Chat.ID, 10), text, parseMode)
+	}
+
+	fields := strings.Fields(msg.Text)
+	if len(fields) > 0 {
+		if handler, ok := commands[fields[0]]; ok {
+			args := strings.Join(fields[1:], " ")
+			handler(ctx, update, args, reply)
+			return
+		}
+	}
+
+	processArticle(ctx, update.UpdateID, msg.Text)
+}
+
+func handleStartCommand(ctx context.Context, update TelegramUpdate, args string, reply func(string, string)) {
+	reply("👋 Send me an article ID to post it, or /help for a list of commands.", "")
+}
+
+func handleHelpCommand(ctx context.Context, update TelegramUpdate, args string, reply func(string, string)) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	reply("Available commands:\n"+strings.Join(names, "\n"), "")
+}
+
+func handleStatusCommand(ctx context.Context, update TelegramUpdate, args string, reply func(string, string)) {
+	stats.mu.Lock()
+	uptime := time.Since(stats.startedAt).Round(time.Second)
+	fetchErrors, hashtagErrors, twitterErrors := stats.fetchErrors, stats.hashtagErrors, stats.twitterErrors
+	stats.mu.Unlock()
+
+	lastPostedID := "none yet"
+	if records, err := store.History(ctx, 1); err != nil {
+		log.Printf("WARNING: could not load last post from store: %v", err)
+	} else if len(records) > 0 {
+		lastPostedID = records[0].ArticleID
+	}
+
+	reply(fmt.Sprintf(
+		"Uptime: %s\nLast posted ID: %s\nErrors — fetch: %d, hashtags: %d, twitter: %d",
+		uptime, lastPostedID, fetchErrors, hashtagErrors, twitterErrors,
+	), "")
+}
+
+func handlePostCommand(ctx context.Context, update TelegramUpdate, args string, reply func(string, string)) {
+	if args == "" {
+		reply("Usage: /post <id>", "")
+		return
+	}
+	processArticle(ctx, update.UpdateID, args)
+}
+
+func handleDryRunCommand(ctx context.Context, update TelegramUpdate, args string, reply func(string, string)) {
+	if args == "" {
+		reply("Usage: /dryrun <id>", "")
+		return
+	}
+
+	article, err := fetchArticle(ctx, args)
+	if err != nil {
+		recordFetchError()
+		reply(fmt.Sprintf("❌ Failed to fetch article with ID %s. Reason: %v", args, err), "")
+		return
+	}
+
+	articleURL := fmt.Sprintf("https://viewon.news/article.html?id=%s", args)
+
+	hashtags, err := getHashtags(ctx, article.Title, article.Description, articleURL)
+	if err != nil {
+		recordHashtagError()
+		reply(fmt.Sprintf("❌ Failed to get hashtags for article with ID %s. Reason: %v", args, err), "")
+		return
+	}
+
+	tweetText := fmt.Sprintf("%s\n%s\n\n%s", article.Title, hashtags, articleURL)
+	log.Printf("[INFO] Dry run composed tweet for article %s", args)
+	reply(fmt.Sprintf("Dry run for ID %s, tweet not sent:\n\n%s", args, tweetText), "")
+}
+
+func handleGroupIDCommand(ctx context.Context, update TelegramUpdate, args string, reply func(string, string)) {
+	reply(fmt.Sprintf("Chat ID: %d", update.Message.Chat.ID), "")
+}
+
+func handleHistoryCommand(ctx context.Context, update TelegramUpdate, args string, reply func(string, string)) {
+	limit := defaultHistoryLimit
+	if args != "" {
+		if n, err := strconv.Atoi(args); err == nil && n > 0 {
+			limit = n
+		}
+	}
+
+	records, err := store.History(ctx, limit)
+	if err != nil {
+		reply(fmt.Sprintf("❌ Could not load history: %v", err), "")
+		return
+	}
+	if len(records) == 0 {
+		reply("No posts recorded yet.", "")
+		return
+	}
+
+	lines := make([]string, len(records))
+	for i, rec := range records {
+		lines[i] = fmt.Sprintf("%s — %s", rec.PostedAt.Format(time.RFC3339), rec.ArticleID)
+	}
+	reply("Last posts:\n"+strings.Join(lines, "\n"), "")
+}
@@ -0,0 +1,493 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	minHashtags = 3
+	maxHashtags = 5
+	maxTweetLen = 280
+)
+
+// HashtagGenerator asks an LLM backend for hashtag suggestions based on an
+// article's title and description. Implementations return raw model
+// output; getHashtags post-processes it uniformly regardless of backend.
+type HashtagGenerator interface {
+	Generate(ctx context.Context, title, description string) (string, error)
+}
+
+// newHashtagGenerator selects a HashtagGenerator from LLM_PROVIDER
+// (openrouter, openai, anthropic, ollama; defaults to openrouter), with
+// LLM_MODEL and LLM_BASE_URL overriding the backend's defaults.
+func newHashtagGenerator() (HashtagGenerator, error) {
+	provider := os.Getenv("LLM_PROVIDER")
+	if provider == "" {
+		provider = "openrouter"
+	}
+	model := os.Getenv("LLM_MODEL")
+	baseURL := os.Getenv("LLM_BASE_URL")
+
+	switch provider {
+	case "openrouter":
+		if model == "" {
+			model = "deepseek/deepseek-r1:free"
+		}
+		return &openRouterGenerator{model: model}, nil
+	case "openai":
+		if baseURL == "" {
+			baseURL = "https://api.openai.com/v1"
+		}
+		if model == "" {
+			model = "gpt-4o-mini"
+		}
+		return &openAIGenerator{baseURL: baseURL, model: model}, nil
+	case "anthropic":
+		if model == "" {
+			model = "claude-3-5-haiku-20241022"
+		}
+		return &anthropicGenerator{model: model}, nil
+	case "ollama":
+		if baseURL == "" {
+			baseURL = "http://localhost:11434"
+		}
+		if model == "" {
+			model = "llama3"
+		}
+		return &ollamaGenerator{baseURL: baseURL, model: model}, nil
+	default:
+		return nil, fmt.Errorf("unknown LLM_PROVIDER: %s", provider)
+	}
+}
+
+// hashtagPrompt is shared across backends.
+func hashtagPrompt(title, description string) string {
+	return fmt.Sprintf("Based on the following news article title and description, generate 3-5 relevant hashtags for a tweet. Do not include any other text, just the hashtags starting with #.\n\nTitle: %s\nDescription: %s", title, description)
+}
+
+// getHashtags asks the configured HashtagGenerator for hashtags and
+// post-processes the result into a tweet-ready, length-safe string, falling
+// back to keyword extraction if the LLM returns nothing usable.
+func getHashtags(ctx context.Context, title, description, articleURL string) (string, error) {
+	generator, err := newHashtagGenerator()
+	if err != nil {
+		return "", err
+	}
+
+	raw, err := generator.Generate(ctx, title, description)
+	if err != nil {
+		return "", err
+	}
+
+	return postProcessHashtags(raw, title, description, articleURL), nil
+}
+
+// --- OpenRouter ---
+
+type openRouterGenerator struct {
+	model string
+}
+
+type openRouterRequest struct {
+	Model    string              `json:"model"`
+	Messages []openRouterMessage `json:"messages"`
+}
+
+type openRouterMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openRouterResponse struct {
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+	} `json:"choices"`
+}
+
+func (g *openRouterGenerator) Generate(ctx context.Context, title, description string) (string, error) {
+	apiKey := os.Getenv("OPENROUTER_API_KEY")
+	if apiKey == "" {
+		return "", fmt.Errorf("OPENROUTER_API_KEY not set")
+	}
+
+	requestBody := openRouterRequest{
+		Model: g.model,
+		Messages: []openRouterMessage{
+			{Role: "user", Content: hashtagPrompt(title, description)},
+		},
+	}
+
+	payload, err := json.Marshal(requestBody)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	var content string
+	err = withRetry(ctx, "openrouter.chatCompletions", func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://openrouter.ai/api/v1/chat/completions", bytes.NewBuffer(payload))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return &retryableError{err: fmt.Errorf("failed to send request to OpenRouter: %w", err)}
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read response body from OpenRouter: %w", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return retryableStatus(resp, body)
+		}
+
+		var parsed openRouterResponse
+		if err := json.Unmarshal(body, &parsed); err != nil {
+			return fmt.Errorf("failed to unmarshal OpenRouter response: %w", err)
+		}
+		if len(parsed.Choices) == 0 {
+			return fmt.Errorf("no content found in OpenRouter response")
+		}
+
+		content = parsed.Choices[0].Message.Content
+		return nil
+	})
+
+	return content, err
+}
+
+// --- OpenAI-compatible ---
+
+type openAIGenerator struct {
+	baseURL string
+	model   string
+}
+
+type openAIRequest struct {
+	Model    string              `json:"model"`
+	Messages []openRouterMessage `json:"messages"`
+}
+
+type openAIResponse struct {
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+	} `json:"choices"`
+}
+
+func (g *openAIGenerator) Generate(ctx context.Context, title, description string) (string, error) {
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	if apiKey == "" {
+		return "", fmt.Errorf("OPENAI_API_KEY not set")
+	}
+
+	requestBody := openAIRequest{
+		Model: g.model,
+		Messages: []openRouterMessage{
+			{Role: "user", Content: hashtagPrompt(title, description)},
+		},
+	}
+
+	payload, err := json.Marshal(requestBody)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	var content string
+	err = withRetry(ctx, "openai.chatCompletions", func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(g.baseURL, "/")+"/chat/completions", bytes.NewBuffer(payload))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return &retryableError{err: fmt.Errorf("failed to send request to OpenAI: %w", err)}
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read response body from OpenAI: %w", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return retryableStatus(resp, body)
+		}
+
+		var parsed openAIResponse
+		if err := json.Unmarshal(body, &parsed); err != nil {
+			return fmt.Errorf("failed to unmarshal OpenAI response: %w", err)
+		}
+		if len(parsed.Choices) == 0 {
+			return fmt.Errorf("no content found in OpenAI response")
+		}
+
+		content = parsed.Choices[0].Message.Content
+		return nil
+	})
+
+	return content, err
+}
+
+// --- Anthropic Messages API ---
+
+type anthropicGenerator struct {
+	model string
+}
+
+type anthropicRequest struct {
+	Model     string              `json:"model"`
+	MaxTokens int                 `json:"max_tokens"`
+	Messages  []openRouterMessage `json:"messages"`
+}
+
+type anthropicResponse struct {
+	Content []struct {
+		Text string `json:"text"`
+	} `json:"content"`
+}
+
+func (g *anthropicGenerator) Generate(ctx context.Context, title, description string) (string, error) {
+	apiKey := os.Getenv("ANTHROPIC_API_KEY")
+	if apiKey == "" {
+		return "", fmt.Errorf("ANTHROPIC_API_KEY not set")
+	}
+
+	requestBody := anthropicRequest{
+		Model:     g.model,
+		MaxTokens: 256,
+		Messages: []openRouterMessage{
+			{Role: "user", Content: hashtagPrompt(title, description)},
+		},
+	}
+
+	payload, err := json.Marshal(requestBody)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	var content string
+	err = withRetry(ctx, "anthropic.messages", func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.anthropic.com/v1/messages", bytes.NewBuffer(payload))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("x-api-key", apiKey)
+		req.Header.Set("anthropic-version", "2023-06-01")
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return &retryableError{err: fmt.Errorf("failed to send request to Anthropic: %w", err)}
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read response body from Anthropic: %w", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return retryableStatus(resp, body)
+		}
+
+		var parsed anthropicResponse
+		if err := json.Unmarshal(body, &parsed); err != nil {
+			return fmt.Errorf("failed to unmarshal Anthropic response: %w", err)
+		}
+		if len(parsed.Content) == 0 {
+			return fmt.Errorf("no content found in Anthropic response")
+		}
+
+		content = parsed.Content[0].Text
+		return nil
+	})
+
+	return content, err
+}
+
+// --- Ollama ---
+
+type ollamaGenerator struct {
+	baseURL string
+	model   string
+}
+
+type ollamaRequest struct {
+	Model    string              `json:"model"`
+	Messages []openRouterMessage `json:"messages"`
+	Stream   bool                `json:"stream"`
+}
+
+type ollamaResponse struct {
+	Message struct {
+		Content string `json:"content"`
+	} `json:"message"`
+}
+
+func (g *ollamaGenerator) Generate(ctx context.Context, title, description string) (string, error) {
+	requestBody := ollamaRequest{
+		Model: g.model,
+		Messages: []openRouterMessage{
+			{Role: "user", Content: hashtagPrompt(title, description)},
+		},
+		Stream: false,
+	}
+
+	payload, err := json.Marshal(requestBody)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	var content string
+	err = withRetry(ctx, "ollama.chat", func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(g.baseURL, "/")+"/api/chat", bytes.NewBuffer(payload))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return &retryableError{err: fmt.Errorf("failed to send request to Ollama: %w", err)}
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read response body from Ollama: %w", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return retryableStatus(resp, body)
+		}
+
+		var parsed ollamaResponse
+		if err := json.Unmarshal(body, &parsed); err != nil {
+			return fmt.Errorf("failed to unmarshal Ollama response: %w", err)
+		}
+
+		content = parsed.Message.Content
+		return nil
+	})
+
+	return content, err
+}
+
+// --- Post-processing ---
+
+var hashtagPattern = regexp.MustCompile(`#\w+`)
+
+// postProcessHashtags extracts and cleans hashtags from raw LLM output,
+// clamping to 3-5 entries and trimming any that would push the tweet over
+// 280 characters. It falls back to keyword extraction when the LLM didn't
+// return anything usable (rate-limited, returned prose, etc).
+func postProcessHashtags(raw, title, description, articleURL string) string {
+	tags := extractHashtags(raw)
+	if tags == nil {
+		tags = extractKeywordHashtags(title, description)
+	}
+
+	tags = fitHashtagsToTweet(tags, title, articleURL)
+	return strings.Join(tags, " ")
+}
+
+// extractHashtags pulls #word tokens out of raw, deduping case-insensitively
+// and clamping to maxHashtags. It returns nil if fewer than minHashtags
+// survive, signaling the caller to fall back to keyword extraction.
+func extractHashtags(raw string) []string {
+	matches := hashtagPattern.FindAllString(raw, -1)
+
+	seen := make(map[string]bool)
+	var tags []string
+	for _, m := range matches {
+		key := strings.ToLower(m)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		tags = append(tags, m)
+		if len(tags) == maxHashtags {
+			break
+		}
+	}
+
+	if len(tags) < minHashtags {
+		return nil
+	}
+	return tags
+}
+
+var hashtagStopwords = map[string]bool{
+	"the": true, "a": true, "an": true, "and": true, "or": true, "of": true,
+	"to": true, "in": true, "on": true, "for": true, "with": true, "is": true,
+	"are": true, "was": true, "were": true, "it": true, "its": true, "by": true,
+	"at": true, "as": true, "that": true, "this": true, "from": true, "be": true,
+	"has": true, "have": true, "will": true, "new": true,
+}
+
+var wordPattern = regexp.MustCompile(`[A-Za-z']+`)
+
+// extractKeywordHashtags builds up to maxHashtags hashtags from the most
+// frequent non-stopword terms in title+description.
+func extractKeywordHashtags(title, description string) []string {
+	counts := make(map[string]int)
+	var order []string
+	for _, word := range wordPattern.FindAllString(title+" "+description, -1) {
+		lower := strings.ToLower(word)
+		if len(lower) < 3 || hashtagStopwords[lower] {
+			continue
+		}
+		if counts[lower] == 0 {
+			order = append(order, lower)
+		}
+		counts[lower]++
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return counts[order[i]] > counts[order[j]]
+	})
+
+	if len(order) > maxHashtags {
+		order = order[:maxHashtags]
+	}
+
+	tags := make([]string, 0, len(order))
+	for _, word := range order {
+		tags = append(tags, "#"+strings.ToUpper(word[:1])+word[1:])
+	}
+	return tags
+}
+
+// fitHashtagsToTweet drops trailing hashtags until title + hashtags + url,
+// combined in the same layout postToTwitter uses, fits within maxTweetLen.
+func fitHashtagsToTweet(tags []string, title, articleURL string) []string {
+	for len(tags) > 0 {
+		tweetText := fmt.Sprintf("%s\n%s\n\n%s", title, strings.Join(tags, " "), articleURL)
+		if len([]rune(tweetText)) <= maxTweetLen {
+			break
+		}
+		tags = tags[:len(tags)-1]
+	}
+	return tags
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestExtractHashtags(t *testing.T) {
+	t.Run("dedupes case-insensitively and clamps to maxHashtags", func(t *testing.T) {
+		raw := "Great read! #Go #go #Rust #Python #Java #C #Extra"
+		got := extractHashtags(raw)
+		want := []string{"#Go", "#Rust", "#Python", "#Java", "#C"}
+		if len(got) != len(want) {
+			t.Fatalf("got %d tags, want %d: %v", len(got), len(want), got)
+		}
+		for i, tag := range want {
+			if got[i] != tag {
+				t.Errorf("tag %d = %q, want %q", i, got[i], tag)
+			}
+		}
+	})
+
+	t.Run("returns nil below minHashtags", func(t *testing.T) {
+		if got := extractHashtags("Only #One #Two here"); got != nil {
+			t.Errorf("expected nil for fewer than %d hashtags, got %v", minHashtags, got)
+		}
+	})
+
+	t.Run("returns nil for prose with no hashtags", func(t *testing.T) {
+		if got := extractHashtags("The model returned plain prose instead of tags."); got != nil {
+			t.Errorf("expected nil, got %v", got)
+		}
+	})
+}
+
+func TestExtractKeywordHashtags(t *testing.T) {
+	title := "Rockets Rockets Rockets win the championship"
+	description := "The rockets delivered a stunning championship performance for the fans."
+
+	got := extractKeywordHashtags(title, description)
+	if len(got) == 0 {
+		t.Fatal("expected at least one hashtag")
+	}
+	if got[0] != "#Rockets" {
+		t.Errorf("expected most frequent word first, got %q (all: %v)", got[0], got)
+	}
+	for _, tag := range got {
+		if len(tag) < 2 || tag[0] != '#' {
+			t.Errorf("tag %q is not hashtag-shaped", tag)
+		}
+	}
+
+	t.Run("skips stopwords and short words", func(t *testing.T) {
+		for _, tag := range got {
+			word := strings.ToLower(strings.TrimPrefix(tag, "#"))
+			if hashtagStopwords[word] {
+				t.Errorf("stopword %q leaked into hashtags", word)
+			}
+			if len(word) < 3 {
+				t.Errorf("word %q shorter than 3 chars leaked into hashtags", word)
+			}
+		}
+	})
+
+	t.Run("clamps to maxHashtags", func(t *testing.T) {
+		longTitle := "alpha bravo charlie delta echo foxtrot golf hotel"
+		got := extractKeywordHashtags(longTitle, "")
+		if len(got) > maxHashtags {
+			t.Errorf("got %d tags, want at most %d", len(got), maxHashtags)
+		}
+	})
+}
+
+func TestFitHashtagsToTweet(t *testing.T) {
+	t.Run("keeps tags that already fit", func(t *testing.T) {
+		tags := []string{"#Go", "#Rust", "#Python"}
+		got := fitHashtagsToTweet(tags, "A short title", "https://viewon.news/article.html?id=1")
+		if len(got) != len(tags) {
+			t.Errorf("expected all %d tags kept, got %d: %v", len(tags), len(got), got)
+		}
+	})
+
+	t.Run("drops trailing tags until the tweet fits", func(t *testing.T) {
+		title := strings.Repeat("word ", 44) // long enough that all 5 tags overflow, but not all need dropping
+		url := "https://viewon.news/article.html?id=1"
+		tags := []string{"#One", "#Two", "#Three", "#Four", "#Five"}
+		got := fitHashtagsToTweet(tags, title, url)
+
+		tweetText := fmt.Sprintf("%s\n%s\n\n%s", title, strings.Join(got, " "), url)
+		if len([]rune(tweetText)) > maxTweetLen {
+			t.Errorf("tweet still over %d chars with tags %v", maxTweetLen, got)
+		}
+		if len(got) == 0 || len(got) >= len(tags) {
+			t.Errorf("expected some but not all tags dropped, kept %d of %d", len(got), len(tags))
+		}
+	})
+
+	t.Run("drops every tag rather than truncating the title or url", func(t *testing.T) {
+		title := strings.Repeat("x", maxTweetLen) // title alone already uses the whole limit
+		got := fitHashtagsToTweet([]string{"#A", "#B"}, title, "https://viewon.news/article.html?id=1")
+		if len(got) != 0 {
+			t.Errorf("expected all tags dropped, got %v", got)
+		}
+	})
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// mediaUploadURL, chunkedUploadThreshold and mediaChunkSize are vars (not
+// consts) so tests can point the endpoint at an httptest.Server and shrink
+// the chunking thresholds instead of uploading real multi-megabyte payloads.
+var (
+	mediaUploadURL = "https://upload.twitter.com/1.1/media/upload.json"
+
+	// chunkedUploadThreshold is Twitter's documented cutover point: images
+	// larger than this must use the INIT/APPEND/FINALIZE chunked flow.
+	chunkedUploadThreshold = 5 * 1024 * 1024
+	mediaChunkSize         = 1 * 1024 * 1024
+)
+
+// maxMediaBytes caps how large an image we'll attempt to upload at all.
+const maxMediaBytes = 20 * 1024 * 1024
+
+// supportedImageContentTypes mirrors Twitter's documented list of image
+// types accepted by the media upload endpoint.
+var supportedImageContentTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/webp": true,
+	"image/gif":  true,
+}
+
+// mediaUploadResponse is the relevant slice of Twitter's media/upload reply.
+type mediaUploadResponse struct {
+	MediaIDString string `json:"media_id_string"`
+}
+
+// uploadTweetImage downloads imageURL and uploads it to Twitter's v1.1 media
+// endpoint using httpClient (already OAuth1-signed by the caller), returning
+// the media_id_string to attach to a v2 tweet. Images over
+// chunkedUploadThreshold go through the INIT/APPEND/FINALIZE chunked flow.
+func uploadTweetImage(ctx context.Context, httpClient *http.Client, imageURL string) (string, error) {
+	contentType, data, err := downloadImage(ctx, imageURL)
+	if err != nil {
+		return "", fmt.Errorf("could not download image: %w", err)
+	}
+
+	if !supportedImageContentTypes[contentType] {
+		return "", fmt.Errorf("unsupported image content-type: %s", contentType)
+	}
+	if len(data) > maxMediaBytes {
+		return "", fmt.Errorf("image is %d bytes, exceeds max upload size of %d bytes", len(data), maxMediaBytes)
+	}
+
+	if len(data) <= chunkedUploadThreshold {
+		return uploadMediaSimple(ctx, httpClient, contentType, data)
+	}
+	return uploadMediaChunked(ctx, httpClient, contentType, data)
+}
+
+// downloadImage fetches imageURL and returns its base content-type (stripped
+// of any parameters) along with the body bytes.
+func downloadImage(ctx context.Context, imageURL string) (string, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imageURL, nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("could not build request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", nil, fmt.Errorf("could not fetch image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxMediaBytes+1))
+	if err != nil {
+		return "", nil, fmt.Errorf("could not read image body: %w", err)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if idx := strings.Index(contentType, ";"); idx != -1 {
+		contentType = contentType[:idx]
+	}
+
+	return strings.TrimSpace(contentType), data, nil
+}
+
+// uploadMediaSimple uploads data in a single multipart/form-data request,
+// used for images at or below chunkedUploadThreshold.
+func uploadMediaSimple(ctx context.Context, httpClient *http.Client, contentType string, data []byte) (string, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	part, err := writer.CreateFormFile("media", "image")
+	if err != nil {
+		return "", fmt.Errorf("could not create form file: %w", err)
+	}
+	if _, err := part.Write(data); err != nil {
+		return "", fmt.Errorf("could not write image bytes: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return "", fmt.Errorf("could not close multipart writer: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, mediaUploadURL, &buf)
+	if err != nil {
+		return "", fmt.Errorf("could not build request: %w", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	return doMediaUpload(httpClient, req)
+}
+
+// uploadMediaChunked drives the INIT/APPEND/FINALIZE flow required for
+// images larger than chunkedUploadThreshold.
+func uploadMediaChunked(ctx context.Context, httpClient *http.Client, contentType string, data []byte) (string, error) {
+	mediaID, err := mediaInit(ctx, httpClient, contentType, len(data))
+	if err != nil {
+		return "", fmt.Errorf("INIT failed: %w", err)
+	}
+
+	for segment, offset := 0, 0; offset < len(data); segment, offset = segment+1, offset+mediaChunkSize {
+		end := offset + mediaChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		if err := mediaAppend(ctx, httpClient, mediaID, segment, data[offset:end]); err != nil {
+			return "", fmt.Errorf("APPEND segment %d failed: %w", segment, err)
+		}
+	}
+
+	if err := mediaFinalize(ctx, httpClient, mediaID); err != nil {
+		return "", fmt.Errorf("FINALIZE failed: %w", err)
+	}
+
+	return mediaID, nil
+}
+
+func mediaInit(ctx context.Context, httpClient *http.Client, contentType string, totalBytes int) (string, error) {
+	form := url.Values{
+		"command":        {"INIT"},
+		"total_bytes":    {strconv.Itoa(totalBytes)},
+		"media_type":     {contentType},
+		"media_category": {"tweet_image"},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, mediaUploadURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("could not build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return doMediaUpload(httpClient, req)
+}
+
+func mediaAppend(ctx context.Context, httpClient *http.Client, mediaID string, segmentIndex int, chunk []byte) error {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	if err := writer.WriteField("command", "APPEND"); err != nil {
+		return fmt.Errorf("could not write command field: %w", err)
+	}
+	if err := writer.WriteField("media_id", mediaID); err != nil {
+		return fmt.Errorf("could not write media_id field: %w", err)
+	}
+	if err := writer.WriteField("segment_index", strconv.Itoa(segmentIndex)); err != nil {
+		return fmt.Errorf("could not write segment_index field: %w", err)
+	}
+	part, err := writer.CreateFormFile("media", "chunk")
+	if err != nil {
+		return fmt.Errorf("could not create form file: %w", err)
+	}
+	if _, err := part.Write(chunk); err != nil {
+		return fmt.Errorf("could not write chunk bytes: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("could not close multipart writer: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, mediaUploadURL, &buf)
+	if err != nil {
+		return fmt.Errorf("could not build request: %w", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	// APPEND returns 2xx with an empty body on success.
+	_, err = doMediaUpload(httpClient, req)
+	return err
+}
+
+func mediaFinalize(ctx context.Context, httpClient *http.Client, mediaID string) error {
+	form := url.Values{
+		"command":  {"FINALIZE"},
+		"media_id": {mediaID},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, mediaUploadURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("could not build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	_, err = doMediaUpload(httpClient, req)
+	return err
+}
+
+// doMediaUpload executes req against the media upload endpoint and parses
+// media_id_string from the response, tolerating an empty body (as returned
+// by a successful APPEND).
+func doMediaUpload(httpClient *http.Client, req *http.Request) (string, error) {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+		return "", fmt.Errorf("received non-2xx status code: %d\nResponse: %s", resp.StatusCode, string(body))
+	}
+
+	if len(body) == 0 {
+		return "", nil
+	}
+
+	var uploadResponse mediaUploadResponse
+	if err := json.Unmarshal(body, &uploadResponse); err != nil {
+		return "", fmt.Errorf("failed to unmarshal media upload response: %w", err)
+	}
+
+	return uploadResponse.MediaIDString, nil
+}
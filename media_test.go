@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newImageServer serves body with the given content-type, as
+// a stand-in for the article's image host.
+func newImageServer(t *testing.T, contentType string, body []byte) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestUploadTweetImageSimple(t *testing.T) {
+	imageSrv := newImageServer(t, "image/png", []byte("fake-png-bytes"))
+
+	uploadSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatalf("expected multipart form, got: %v", err)
+		}
+		if _, _, err := r.FormFile("media"); err != nil {
+			t.Fatalf("expected media form file: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"media_id_string": "12345"}`))
+	}))
+	t.Cleanup(uploadSrv.Close)
+
+	mediaUploadURL = uploadSrv.URL
+	defer func() { mediaUploadURL = "https://upload.twitter.com/1.1/media/upload.json" }()
+
+	mediaID, err := uploadTweetImage(context.Background(), http.DefaultClient, imageSrv.URL)
+	if err != nil {
+		t.Fatalf("uploadTweetImage returned error: %v", err)
+	}
+	if mediaID != "12345" {
+		t.Errorf("expected media ID %q, got %q", "12345", mediaID)
+	}
+}
+
+func TestUploadTweetImageChunked(t *testing.T) {
+	imageBody := make([]byte, 30)
+	for i := range imageBody {
+		imageBody[i] = byte(i)
+	}
+	imageSrv := newImageServer(t, "image/jpeg", imageBody)
+
+	var gotInit, gotFinalize bool
+	var appendSegments []string
+
+	uploadSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseMultipartForm(1 << 20) // ignore error; command may arrive as a plain form for INIT/FINALIZE
+
+		command := r.FormValue("command")
+		switch command {
+		case "INIT":
+			gotInit = true
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"media_id_string": "99999"}`))
+		case "APPEND":
+			appendSegments = append(appendSegments, r.FormValue("segment_index"))
+			w.WriteHeader(http.StatusNoContent)
+		case "FINALIZE":
+			gotFinalize = true
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"media_id_string": "99999"}`))
+		default:
+			t.Fatalf("unexpected command: %q", command)
+		}
+	}))
+	t.Cleanup(uploadSrv.Close)
+
+	mediaUploadURL = uploadSrv.URL
+	origThreshold, origChunk := chunkedUploadThreshold, mediaChunkSize
+	chunkedUploadThreshold = 10
+	mediaChunkSize = 10
+	defer func() {
+		mediaUploadURL = "https://upload.twitter.com/1.1/media/upload.json"
+		chunkedUploadThreshold = origThreshold
+		mediaChunkSize = origChunk
+	}()
+
+	mediaID, err := uploadTweetImage(context.Background(), http.DefaultClient, imageSrv.URL)
+	if err != nil {
+		t.Fatalf("uploadTweetImage returned error: %v", err)
+	}
+	if mediaID != "99999" {
+		t.Errorf("expected media ID %q, got %q", "99999", mediaID)
+	}
+	if !gotInit || !gotFinalize {
+		t.Errorf("expected both INIT and FINALIZE to be called, got init=%v finalize=%v", gotInit, gotFinalize)
+	}
+	if len(appendSegments) != 3 {
+		t.Errorf("expected 3 APPEND segments for a 30-byte image chunked at 10 bytes, got %d", len(appendSegments))
+	}
+}
+
+func TestUploadTweetImageUnsupportedContentType(t *testing.T) {
+	imageSrv := newImageServer(t, "image/bmp", []byte("fake-bmp-bytes"))
+
+	_, err := uploadTweetImage(context.Background(), http.DefaultClient, imageSrv.URL)
+	if err == nil {
+		t.Fatal("expected an error for an unsupported content-type, got nil")
+	}
+}
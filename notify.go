@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+)
+
+// markdownV2Escaper escapes every character Telegram's MarkdownV2 parse mode
+// treats as reserved, per https://core.telegram.org/bots/api#markdownv2-style.
+var markdownV2Escaper = strings.NewReplacer(
+	"_", "\\_", "*", "\\*", "[", "\\[", "]", "\\]", "(", "\\(", ")", "\\)",
+	"~", "\\~", "`", "\\`", ">", "\\>", "#", "\\#", "+", "\\+", "-", "\\-",
+	"=", "\\=", "|", "\\|", "{", "\\{", "}", "\\}", ".", "\\.", "!", "\\!",
+)
+
+// escapeMarkdownV2 escapes s so it can be safely embedded in a MarkdownV2
+// message; without it, article titles or other free text containing
+// reserved characters would break Telegram's parser.
+func escapeMarkdownV2(s string) string {
+	return markdownV2Escaper.Replace(s)
+}
+
+// NotificationField is a single labeled row on a NotificationCard.
+type NotificationField struct {
+	Name  string
+	Value string
+}
+
+// NotificationCard is a structured notification payload rendered as a
+// MarkdownV2 message, used instead of hand-built strings so callers can't
+// forget to escape user-supplied text.
+type NotificationCard struct {
+	Title  string
+	Fields []NotificationField
+	Link   string
+}
+
+// renderMarkdownV2 renders the card as a MarkdownV2 message, escaping every
+// field value.
+func (c NotificationCard) renderMarkdownV2() string {
+	var b strings.Builder
+	b.WriteString("*" + escapeMarkdownV2(c.Title) + "*")
+	for _, f := range c.Fields {
+		b.WriteString("\n*" + escapeMarkdownV2(f.Name) + ":* " + escapeMarkdownV2(f.Value))
+	}
+	if c.Link != "" {
+		b.WriteString("\n" + escapeMarkdownV2(c.Link))
+	}
+	return b.String()
+}
+
+// sendNotificationCard renders card and sends it to the bot's configured
+// TELEGRAM_CHAT_ID with MarkdownV2 parsing.
+func sendNotificationCard(ctx context.Context, card NotificationCard) {
+	chatID := os.Getenv("TELEGRAM_CHAT_ID")
+	if chatID == "" {
+		log.Println("WARNING: TELEGRAM_CHAT_ID not set. Cannot send notification.")
+		return
+	}
+	sendMessage(ctx, chatID, card.renderMarkdownV2(), "MarkdownV2")
+}
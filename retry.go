@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	retryInitialDelay       = 500 * time.Millisecond
+	retryFactor             = 2.0
+	retryMaxDelay           = 30 * time.Second
+	retryMaxElapsed         = 2 * time.Minute
+	circuitBreakerThreshold = 5
+	circuitBreakerCooldown  = 1 * time.Minute
+)
+
+// retryableError marks an error as safe to retry (network failure, 5xx, or
+// 429) and optionally carries a server-specified delay to honor instead of
+// the computed backoff.
+type retryableError struct {
+	err        error
+	retryAfter time.Duration
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
+// retryableStatus turns a non-2xx HTTP response into an error, marking it
+// retryable for 429 and 5xx responses and honoring any Retry-After header.
+func retryableStatus(resp *http.Response, body []byte) error {
+	baseErr := fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+		return baseErr
+	}
+	return &retryableError{err: baseErr, retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+}
+
+// parseRetryAfter accepts both the seconds and HTTP-date forms of
+// Retry-After. It returns 0 if the header is absent, malformed, or already
+// in the past.
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if when, err := http.ParseTime(header); err == nil {
+		if d := time.Until(when); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// breaker trips an endpoint after circuitBreakerThreshold consecutive
+// failures, short-circuiting further attempts until a call succeeds again.
+// After circuitBreakerCooldown it goes half-open, letting a single trial
+// call through; a failure there re-trips and restarts the cooldown, a
+// success clears it.
+type breaker struct {
+	mu                  sync.Mutex
+	consecutiveFailures int
+	tripped             bool
+	trippedAt           time.Time
+}
+
+var breakers = struct {
+	mu    sync.Mutex
+	byKey map[string]*breaker
+}{byKey: make(map[string]*breaker)}
+
+func breakerFor(endpoint string) *breaker {
+	breakers.mu.Lock()
+	defer breakers.mu.Unlock()
+	b, ok := breakers.byKey[endpoint]
+	if !ok {
+		b = &breaker{}
+		breakers.byKey[endpoint] = b
+	}
+	return b
+}
+
+func (b *breaker) recordResult(endpoint string, err error) {
+	b.mu.Lock()
+	if err == nil {
+		b.consecutiveFailures = 0
+		b.tripped = false
+		b.mu.Unlock()
+		return
+	}
+
+	b.consecutiveFailures++
+	justTripped := false
+	if b.consecutiveFailures >= circuitBreakerThreshold {
+		justTripped = !b.tripped
+		b.tripped = true
+		b.trippedAt = time.Now()
+	}
+	failures := b.consecutiveFailures
+	b.mu.Unlock()
+
+	// Send the alert after releasing b.mu: this notification goes through
+	// withRetry/breakerFor itself, and if the tripping endpoint is the
+	// notification endpoint (e.g. "telegram.sendMessage"), isTripped would
+	// deadlock trying to re-lock the same non-reentrant mutex.
+	if justTripped {
+		alert := fmt.Sprintf("🚨 Circuit breaker tripped for %s after %d consecutive failures: %v", endpoint, failures, err)
+		log.Println(alert)
+		// Use a fresh context: the alert must go out even if the call that
+		// tripped the breaker was itself cancelled.
+		sendTelegramNotification(context.Background(), alert, "")
+	}
+}
+
+// isTripped reports whether the breaker should short-circuit the call. Once
+// circuitBreakerCooldown has elapsed since tripping, it goes half-open and
+// lets one trial call through instead of staying open forever.
+func (b *breaker) isTripped() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.tripped {
+		return false
+	}
+	if time.Since(b.trippedAt) >= circuitBreakerCooldown {
+		// Restart the cooldown so calls arriving while this trial is in
+		// flight are still short-circuited.
+		b.trippedAt = time.Now()
+		return false
+	}
+	return true
+}
+
+// withRetry runs fn with exponential backoff and jitter (initial
+// retryInitialDelay, factor retryFactor, capped at retryMaxDelay, giving up
+// after retryMaxElapsed total). It only retries errors wrapped as
+// *retryableError (network failures, 5xx, 429) and honors any Retry-After
+// delay they carry. endpoint identifies the circuit breaker: once it trips,
+// further calls short-circuit instead of hammering a failing upstream.
+func withRetry(ctx context.Context, endpoint string, fn func() error) error {
+	b := breakerFor(endpoint)
+	if b.isTripped() {
+		return fmt.Errorf("circuit breaker open for %s, skipping call", endpoint)
+	}
+
+	delay := retryInitialDelay
+	deadline := time.Now().Add(retryMaxElapsed)
+
+	for {
+		err := fn()
+		b.recordResult(endpoint, err)
+		if err == nil {
+			return nil
+		}
+
+		var retryable *retryableError
+		if !errors.As(err, &retryable) {
+			return err
+		}
+
+		wait := delay
+		if retryable.retryAfter > 0 {
+			wait = retryable.retryAfter
+		}
+		if time.Now().Add(wait).After(deadline) {
+			return fmt.Errorf("giving up on %s after %s: %w", endpoint, retryMaxElapsed, err)
+		}
+
+		wait += time.Duration(rand.Int63n(int64(wait)/2 + 1)) // jitter
+		log.Printf("WARNING: %s failed, retrying in %s: %v", endpoint, wait, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+
+		delay = time.Duration(float64(delay) * retryFactor)
+		if delay > retryMaxDelay {
+			delay = retryMaxDelay
+		}
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,6 +10,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/dghubble/oauth1"
 	"github.com/joho/godotenv"
@@ -22,7 +24,13 @@ type TelegramUpdate struct {
 
 // TelegramMessage represents a message from Telegram.
 type TelegramMessage struct {
-	Text string `json:"text"`
+	Text string       `json:"text"`
+	Chat TelegramChat `json:"chat"`
+}
+
+// TelegramChat identifies the chat a message was sent in.
+type TelegramChat struct {
+	ID int64 `json:"id"`
 }
 
 // Article represents the data fetched from the viewon.news API.
@@ -32,6 +40,11 @@ type Article struct {
 	Image       string `json:"image"`
 }
 
+// store is the idempotency store used to dedupe Telegram updates and back
+// /status and /history. It defaults to an in-memory store; set STORE_PATH
+// to persist it to a SQLite file across restarts.
+var store Store = NewMemoryStore()
+
 func main() {
 	// Load environment variables from .env file
 	err := godotenv.Load()
@@ -39,11 +52,33 @@ func main() {
 		log.Println("Error loading .env file, using environment variables")
 	}
 
+	if path := os.Getenv("STORE_PATH"); path != "" {
+		sqliteStore, err := NewSQLiteStore(path)
+		if err != nil {
+			log.Fatalf("could not open store at %s: %v", path, err)
+		}
+		store = sqliteStore
+	}
+
 	// Handlers
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprint(w, "The server is running.")
 	})
-	http.HandleFunc("/telegram", telegramHandler)
+
+	// TELEGRAM_MODE selects how updates are ingested: "webhook" (default)
+	// registers the /telegram handler for Telegram to push to, "poll" runs
+	// runLongPoll instead so the bot works without a public URL.
+	if os.Getenv("TELEGRAM_MODE") == "poll" {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			if err := runLongPoll(ctx); err != nil {
+				log.Printf("long-poll loop stopped: %v", err)
+			}
+		}()
+	} else {
+		http.HandleFunc("/telegram", telegramHandler)
+	}
 
 	// Start the server
 	log.Println("Starting server on :8080")
@@ -63,62 +98,121 @@ func telegramHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Received message from user: %s", update.Message.Text)
 	log.Println("[SUCCESS] New message received and decoded.")
 
+	dispatchMessage(r.Context(), update)
+
+	// Always report OK once decoded so Telegram doesn't redeliver; failures
+	// downstream are reported via a Telegram notification instead.
+	w.WriteHeader(http.StatusOK)
+}
+
+// processArticle runs the fetch -> hashtag -> tweet pipeline for a single
+// article ID. It's the default handler for a bare message and backs the
+// /post command. updateID is claimed in the store before the pipeline
+// starts (not just recorded after it succeeds), so a Telegram redelivery
+// arriving while the first attempt is still in flight is rejected instead
+// of racing it and posting twice. The claim is released if the pipeline
+// doesn't complete, so a redelivery after a genuine failure can still retry.
+func processArticle(ctx context.Context, updateID int, id string) {
+	claimed, err := store.Claim(ctx, updateID)
+	if err != nil {
+		log.Printf("WARNING: could not claim update %d in store: %v", updateID, err)
+	} else if !claimed {
+		log.Printf("[INFO] Update %d already claimed, skipping to avoid a duplicate post.", updateID)
+		return
+	}
+
+	posted := false
+	defer func() {
+		if !posted {
+			if err := store.Release(ctx, updateID); err != nil {
+				log.Printf("WARNING: could not release claim for update %d: %v", updateID, err)
+			}
+		}
+	}()
+
 	// --- Input Validation to prevent retry loops ---
-	if strings.HasPrefix(update.Message.Text, "http://") || strings.HasPrefix(update.Message.Text, "https://") {
-		log.Println("[INFO] Received a URL instead of an ID. Ignoring and sending 200 OK to clear Telegram's queue.")
-		w.WriteHeader(http.StatusOK) // Send OK to stop Telegram from retrying.
+	if strings.HasPrefix(id, "http://") || strings.HasPrefix(id, "https://") {
+		log.Println("[INFO] Received a URL instead of an ID. Ignoring.")
 		return
 	}
 	// --- End of Input Validation ---
 
 	// Fetch the article using the message text as the ID
-	article, err := fetchArticle(update.Message.Text)
+	article, err := fetchArticle(ctx, id)
 	if err != nil {
-		errMsg := fmt.Sprintf("❌ Failed to fetch article with ID %s. Reason: %v", update.Message.Text, err)
-		sendTelegramNotification(errMsg, "") // Send error as plain text
+		recordFetchError()
+		errMsg := fmt.Sprintf("❌ Failed to fetch article with ID %s. Reason: %v", id, err)
+		sendTelegramNotification(ctx, errMsg, "") // Send error as plain text
 		log.Printf("could not fetch article: %v", err)
-		// We've handled the error by notifying. Now tell Telegram we're OK to prevent retries.
-		w.WriteHeader(http.StatusOK)
 		return
 	}
 	log.Println("[SUCCESS] Article data fetched.")
 
-	// Get hashtags from OpenRouter
-	hashtags, err := getHashtags(article.Title, article.Description)
+	articleURL := fmt.Sprintf("https://viewon.news/article.html?id=%s", id)
+
+	// Get hashtags from the configured LLM backend
+	hashtags, err := getHashtags(ctx, article.Title, article.Description, articleURL)
 	if err != nil {
-		errMsg := fmt.Sprintf("❌ Failed to get hashtags for article with ID %s. Reason: %v", update.Message.Text, err)
-		sendTelegramNotification(errMsg, "") // Send error as plain text
+		recordHashtagError()
+		errMsg := fmt.Sprintf("❌ Failed to get hashtags for article with ID %s. Reason: %v", id, err)
+		sendTelegramNotification(ctx, errMsg, "") // Send error as plain text
 		log.Printf("ERROR: could not get hashtags: %v", err)
-		// We've handled the error. Tell Telegram we're OK to prevent retries.
-		w.WriteHeader(http.StatusOK)
 		return
 	}
 	log.Println("[SUCCESS] Hashtags generated.")
 
 	// Post the article to Twitter
-	if err := postToTwitter(article, update.Message.Text, hashtags); err != nil {
-		errMsg := fmt.Sprintf("❌ Failed to post to Twitter for article with ID %s. Reason: %v", update.Message.Text, err)
-		sendTelegramNotification(errMsg, "") // Send error as plain text
+	tweetID, err := postToTwitter(ctx, article, id, hashtags)
+	if err != nil {
+		recordTwitterError()
+		errMsg := fmt.Sprintf("❌ Failed to post to Twitter for article with ID %s. Reason: %v", id, err)
+		sendTelegramNotification(ctx, errMsg, "") // Send error as plain text
 		log.Printf("could not post to twitter: %v", err)
-		// We've handled the error. Tell Telegram we're OK to prevent retries.
-		w.WriteHeader(http.StatusOK)
 		return
 	}
 	log.Println("[SUCCESS] Tweet posted to X.")
+	posted = true
 
-	w.WriteHeader(http.StatusOK)
-	// Send a success notification with Markdown formatting.
-	successMessage := fmt.Sprintf("✅ Successfully posted article with ID: `%s`", update.Message.Text)
-	sendTelegramNotification(successMessage, "MarkdownV2")
+	if err := store.Record(ctx, PostRecord{UpdateID: updateID, ArticleID: id, TweetID: tweetID, PostedAt: time.Now()}); err != nil {
+		log.Printf("WARNING: could not record post for update %d: %v", updateID, err)
+	}
+
+	// Send a success notification rendered as a formatted card.
+	card := NotificationCard{
+		Title: "✅ Successfully posted article",
+		Fields: []NotificationField{
+			{Name: "Title", Value: article.Title},
+			{Name: "Article URL", Value: articleURL},
+			{Name: "Hashtags", Value: hashtags},
+		},
+	}
+	if tweetID != "" {
+		card.Fields = append(card.Fields, NotificationField{
+			Name:  "Tweet URL",
+			Value: fmt.Sprintf("https://twitter.com/i/web/status/%s", tweetID),
+		})
+	}
+	sendNotificationCard(ctx, card)
 }
 
-// sendTelegramNotification sends a formatted message to a specified Telegram chat.
-func sendTelegramNotification(message string, parseMode string) {
-	botToken := os.Getenv("TELEGRAM_BOT_TOKEN")
+// sendTelegramNotification sends a message to the bot's configured
+// TELEGRAM_CHAT_ID, retrying transient failures with backoff.
+func sendTelegramNotification(ctx context.Context, message string, parseMode string) {
 	chatID := os.Getenv("TELEGRAM_CHAT_ID")
+	if chatID == "" {
+		log.Println("WARNING: TELEGRAM_CHAT_ID not set. Cannot send notification.")
+		return
+	}
+	sendMessage(ctx, chatID, message, parseMode)
+}
 
-	if botToken == "" || chatID == "" {
-		log.Println("WARNING: TELEGRAM_BOT_TOKEN or TELEGRAM_CHAT_ID not set. Cannot send notification.")
+// sendMessage sends a message to an arbitrary Telegram chat, retrying
+// transient failures with backoff. It backs sendTelegramNotification as well
+// as command replies, which target whichever chat the command came from.
+func sendMessage(ctx context.Context, chatID string, message string, parseMode string) {
+	botToken := os.Getenv("TELEGRAM_BOT_TOKEN")
+	if botToken == "" {
+		log.Println("WARNING: TELEGRAM_BOT_TOKEN not set. Cannot send message.")
 		return
 	}
 
@@ -140,49 +234,91 @@ func sendTelegramNotification(message string, parseMode string) {
 		return
 	}
 
-	resp, err := http.Post(apiURL, "application/json", bytes.NewBuffer(requestBody))
+	err = withRetry(ctx, "telegram.sendMessage", func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, bytes.NewBuffer(requestBody))
+		if err != nil {
+			return fmt.Errorf("could not build request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return &retryableError{err: fmt.Errorf("could not send message to Telegram: %w", err)}
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			return retryableStatus(resp, body)
+		}
+		return nil
+	})
 	if err != nil {
-		log.Printf("WARNING: Failed to send notification to Telegram: %v", err)
+		log.Printf("WARNING: Failed to send message to Telegram: %v", err)
 		return
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		log.Printf("WARNING: Telegram API returned non-200 status for notification: %s", string(body))
-	} else {
-		log.Printf("[SUCCESS] Sent notification to Telegram group: %s", message)
-	}
+	log.Printf("[SUCCESS] Sent message to Telegram chat %s: %s", chatID, message)
 }
 
-func fetchArticle(id string) (*Article, error) {
-	url := fmt.Sprintf("https://viewon.news/notion.php?id=%s", id)
-	resp, err := http.Get(url)
+func fetchArticle(ctx context.Context, id string) (*Article, error) {
+	var article Article
+	err := withRetry(ctx, "viewon.fetchArticle", func() error {
+		url := fmt.Sprintf("https://viewon.news/notion.php?id=%s", id)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return fmt.Errorf("could not build request: %w", err)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return &retryableError{err: fmt.Errorf("could not fetch article: %w", err)}
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			return retryableStatus(resp, body)
+		}
+
+		if err := json.NewDecoder(resp.Body).Decode(&article); err != nil {
+			return fmt.Errorf("could not decode article data: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("could not fetch article: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
+	return &article, nil
+}
 
-	var article Article
-	if err := json.NewDecoder(resp.Body).Decode(&article); err != nil {
-		return nil, fmt.Errorf("could not decode article data: %w", err)
-	}
+// TwitterTweetResponse is the relevant slice of the v2 create-tweet response.
+type TwitterTweetResponse struct {
+	Data struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
 
-	return &article, nil
+// tweetRequest is the v2 create-tweet request body.
+type tweetRequest struct {
+	Text  string      `json:"text"`
+	Media *tweetMedia `json:"media,omitempty"`
+}
+
+type tweetMedia struct {
+	MediaIDs []string `json:"media_ids"`
 }
 
-func postToTwitter(article *Article, messageID string, hashtags string) error {
+// postToTwitter posts the article as a tweet and returns the created tweet's
+// ID (suitable for building a https://twitter.com/i/web/status/<id> link).
+func postToTwitter(ctx context.Context, article *Article, messageID string, hashtags string) (string, error) {
 	consumerKey := os.Getenv("TWITTER_CONSUMER_KEY")
 	consumerSecret := os.Getenv("TWITTER_CONSUMER_SECRET")
 	accessToken := os.Getenv("TWITTER_ACCESS_TOKEN")
 	accessSecret := os.Getenv("TWITTER_ACCESS_SECRET")
 
 	if consumerKey == "" || consumerSecret == "" || accessToken == "" || accessSecret == "" {
-		return fmt.Errorf("twitter api credentials not set")
+		return "", fmt.Errorf("twitter api credentials not set")
 	}
 
 	config := oauth1.NewConfig(consumerKey, consumerSecret)
@@ -198,112 +334,64 @@ func postToTwitter(article *Article, messageID string, hashtags string) error {
 	// 2. Set the tweet text
 	tweetText := fmt.Sprintf("%s\n%s\n\n%s", article.Title, hashtags, articleURL)
 
-	// 3. Create the JSON payload for the v2 endpoint
-	payload := []byte(fmt.Sprintf(`{"text": %q}`, tweetText))
-
-	// 3. The API v2 endpoint for creating a tweet
-	tweetURL := "https://api.twitter.com/2/tweets"
-
-	// 4. Create the HTTP request
-	req, err := http.NewRequest("POST", tweetURL, bytes.NewBuffer(payload))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	// 5. Send the request using the authenticated httpClient
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// 6. Read the response body
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read response body: %w", err)
+	// 2b. Attach the article image, if any, via the v1.1 media upload flow.
+	tweet := tweetRequest{Text: tweetText}
+	if article.Image != "" {
+		mediaID, err := uploadTweetImage(ctx, httpClient, article.Image)
+		if err != nil {
+			return "", fmt.Errorf("failed to upload image: %w", err)
+		}
+		tweet.Media = &tweetMedia{MediaIDs: []string{mediaID}}
 	}
 
-	// 7. Check the response status code
-	if resp.StatusCode != http.StatusCreated { // A successful v2 tweet creation returns 201 Created
-		return fmt.Errorf("received non-201 status code: %d\nResponse: %s", resp.StatusCode, string(body))
-	}
-
-	log.Println("[SUCCESS] Tweet posted to X.")
-	return nil
-}
-
-// Structs for OpenRouter API
-type OpenRouterRequest struct {
-	Model    string              `json:"model"`
-	Messages []OpenRouterMessage `json:"messages"`
-}
-
-type OpenRouterMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
-}
-
-type OpenRouterResponse struct {
-	Choices []struct {
-		Message struct {
-			Content string `json:"content"`
-		} `json:"message"`
-	} `json:"choices"`
-}
-
-func getHashtags(title, description string) (string, error) {
-	apiKey := os.Getenv("OPENROUTER_API_KEY")
-	if apiKey == "" {
-		return "", fmt.Errorf("OPENROUTER_API_KEY not set")
-	}
-
-	prompt := fmt.Sprintf("Based on the following news article title and description, generate 3-5 relevant hashtags for a tweet. Do not include any other text, just the hashtags starting with #.\n\nTitle: %s\nDescription: %s", title, description)
-
-	requestBody := OpenRouterRequest{
-		Model: "deepseek/deepseek-r1:free", // Use the user-specified free model
-		Messages: []OpenRouterMessage{
-			{Role: "user", Content: prompt},
-		},
-	}
-
-	payload, err := json.Marshal(requestBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request body: %w", err)
-	}
-
-	req, err := http.NewRequest("POST", "https://openrouter.ai/api/v1/chat/completions", bytes.NewBuffer(payload))
+	// 3. Create the JSON payload for the v2 endpoint
+	payload, err := json.Marshal(tweet)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return "", fmt.Errorf("failed to marshal tweet payload: %w", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to send request to OpenRouter: %w", err)
-	}
-	defer resp.Body.Close()
+	// 3. The API v2 endpoint for creating a tweet
+	tweetURL := "https://api.twitter.com/2/tweets"
 
-	body, err := io.ReadAll(resp.Body)
+	var tweetID string
+	err = withRetry(ctx, "twitter.postTweet", func() error {
+		// 4. Create the HTTP request
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, tweetURL, bytes.NewBuffer(payload))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		// 5. Send the request using the authenticated httpClient
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return &retryableError{err: fmt.Errorf("failed to send request: %w", err)}
+		}
+		defer resp.Body.Close()
+
+		// 6. Read the response body
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read response body: %w", err)
+		}
+
+		// 7. Check the response status code
+		if resp.StatusCode != http.StatusCreated { // A successful v2 tweet creation returns 201 Created
+			return retryableStatus(resp, body)
+		}
+
+		var tweetResponse TwitterTweetResponse
+		if err := json.Unmarshal(body, &tweetResponse); err != nil {
+			return fmt.Errorf("failed to unmarshal tweet response: %w", err)
+		}
+		tweetID = tweetResponse.Data.ID
+
+		log.Println("[SUCCESS] Tweet posted to X.")
+		return nil
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to read response body from OpenRouter: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("received non-200 status from OpenRouter: %s", string(body))
-	}
-
-	var openRouterResponse OpenRouterResponse
-	if err := json.Unmarshal(body, &openRouterResponse); err != nil {
-		return "", fmt.Errorf("failed to unmarshal OpenRouter response: %w", err)
-	}
-
-	if len(openRouterResponse.Choices) > 0 {
-		return openRouterResponse.Choices[0].Message.Content, nil
+		return "", err
 	}
 
-	return "", fmt.Errorf("no content found in OpenRouter response")
+	return tweetID, nil
 }
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// PostRecord is one completed pipeline run, keyed by the Telegram update
+// that triggered it.
+type PostRecord struct {
+	UpdateID  int
+	ArticleID string
+	TweetID   string
+	PostedAt  time.Time
+}
+
+// Store tracks which Telegram updates are in-flight or already processed, so
+// a webhook retry (Telegram redelivers on any non-2xx or timeout, including
+// one arriving while the first attempt is still running) can't post the
+// same article twice.
+type Store interface {
+	// Claim atomically marks updateID as in-flight, returning true if this
+	// call is the first to claim it. A second call for the same updateID —
+	// including one racing in while the first is still running the pipeline
+	// — returns false so the caller can skip reprocessing.
+	Claim(ctx context.Context, updateID int) (bool, error)
+	// Record stores the result of a completed pipeline run for an
+	// already-claimed updateID.
+	Record(ctx context.Context, rec PostRecord) error
+	// Release un-claims updateID after a pipeline run failed, so a
+	// legitimate retry (Telegram redelivering after a timeout) can attempt
+	// it again instead of being skipped forever.
+	Release(ctx context.Context, updateID int) error
+	// History returns up to n most recently recorded posts, newest first.
+	History(ctx context.Context, n int) ([]PostRecord, error)
+}
+
+// MemoryStore is an in-memory Store. It's the default when no database path
+// is configured; it does not survive a restart.
+type MemoryStore struct {
+	mu      sync.Mutex
+	claimed map[int]bool
+	history []PostRecord
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{claimed: make(map[int]bool)}
+}
+
+func (s *MemoryStore) Claim(ctx context.Context, updateID int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.claimed[updateID] {
+		return false, nil
+	}
+	s.claimed[updateID] = true
+	return true, nil
+}
+
+func (s *MemoryStore) Record(ctx context.Context, rec PostRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.claimed[rec.UpdateID] = true
+	s.history = append(s.history, rec)
+	return nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, updateID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.claimed, updateID)
+	return nil
+}
+
+func (s *MemoryStore) History(ctx context.Context, n int) ([]PostRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n > len(s.history) {
+		n = len(s.history)
+	}
+	out := make([]PostRecord, n)
+	for i := 0; i < n; i++ {
+		out[i] = s.history[len(s.history)-1-i]
+	}
+	return out, nil
+}
+
+// SQLiteStore is a Store backed by a SQLite database file, so processed
+// updates survive a restart. Selected by setting STORE_PATH.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open sqlite store: %w", err)
+	}
+
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS posts (
+			update_id  INTEGER PRIMARY KEY,
+			article_id TEXT NOT NULL,
+			tweet_id   TEXT NOT NULL,
+			posted_at  DATETIME NOT NULL
+		)
+	`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not create posts table: %w", err)
+	}
+
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS claims (
+			update_id  INTEGER PRIMARY KEY,
+			claimed_at DATETIME NOT NULL
+		)
+	`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not create claims table: %w", err)
+	}
+
+	return &SQLiteStore{db: db}, nil
+}
+
+func (s *SQLiteStore) Claim(ctx context.Context, updateID int) (bool, error) {
+	result, err := s.db.ExecContext(ctx,
+		`INSERT OR IGNORE INTO claims (update_id, claimed_at) VALUES (?, ?)`,
+		updateID, time.Now(),
+	)
+	if err != nil {
+		return false, fmt.Errorf("could not claim update %d: %w", updateID, err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("could not check claim result for update %d: %w", updateID, err)
+	}
+	return rows > 0, nil
+}
+
+func (s *SQLiteStore) Release(ctx context.Context, updateID int) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM claims WHERE update_id = ?`, updateID); err != nil {
+		return fmt.Errorf("could not release claim for update %d: %w", updateID, err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) Record(ctx context.Context, rec PostRecord) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO posts (update_id, article_id, tweet_id, posted_at) VALUES (?, ?, ?, ?)`,
+		rec.UpdateID, rec.ArticleID, rec.TweetID, rec.PostedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("could not record update %d: %w", rec.UpdateID, err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) History(ctx context.Context, n int) ([]PostRecord, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT update_id, article_id, tweet_id, posted_at FROM posts ORDER BY posted_at DESC LIMIT ?`, n,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not query history: %w", err)
+	}
+	defer rows.Close()
+
+	var out []PostRecord
+	for rows.Next() {
+		var rec PostRecord
+		if err := rows.Scan(&rec.UpdateID, &rec.ArticleID, &rec.TweetID, &rec.PostedAt); err != nil {
+			return nil, fmt.Errorf("could not scan history row: %w", err)
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// getUpdatesResponse mirrors Telegram's getUpdates envelope.
+type getUpdatesResponse struct {
+	OK     bool             `json:"ok"`
+	Result []TelegramUpdate `json:"result"`
+}
+
+const (
+	pollTimeoutSeconds = 30
+	pollMinBackoff     = 5 * time.Second
+)
+
+// runLongPoll drives the bot via Telegram's getUpdates long-polling API
+// instead of the /telegram webhook. It's selected with TELEGRAM_MODE=poll so
+// the bot can run behind NAT or on a dev machine without a public URL.
+func runLongPoll(ctx context.Context) error {
+	botToken := os.Getenv("TELEGRAM_BOT_TOKEN")
+	if botToken == "" {
+		return fmt.Errorf("TELEGRAM_BOT_TOKEN not set")
+	}
+
+	if err := deleteWebhook(botToken); err != nil {
+		log.Printf("WARNING: could not delete webhook before polling: %v", err)
+	}
+
+	// updateTicker paces getUpdates attempts and doubles as the backoff floor
+	// on transient errors; getUpdates itself already long-polls, so there's
+	// no separate in-flight state for a second ticker to clean up.
+	updateTicker := time.NewTicker(pollMinBackoff)
+	defer updateTicker.Stop()
+
+	offset := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-updateTicker.C:
+			updates, err := getUpdates(ctx, botToken, offset)
+			if err != nil {
+				log.Printf("WARNING: getUpdates failed, backing off: %v", err)
+				// Drop any tick queued while the failed call ran, so the
+				// retry waits a full pollMinBackoff.
+				select {
+				case <-updateTicker.C:
+				default:
+				}
+				updateTicker.Reset(pollMinBackoff)
+				continue
+			}
+			for _, update := range updates {
+				offset = update.UpdateID + 1
+				log.Printf("Received message from user: %s", update.Message.Text)
+
+				dispatchMessage(ctx, update)
+			}
+		}
+	}
+}
+
+// getUpdates fetches new updates from Telegram starting at offset, long
+// polling for up to pollTimeoutSeconds.
+func getUpdates(ctx context.Context, botToken string, offset int) ([]TelegramUpdate, error) {
+	apiURL := fmt.Sprintf("https://api.telegram.org/bot%s/getUpdates?offset=%d&timeout=%d", botToken, offset, pollTimeoutSeconds)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not build getUpdates request: %w", err)
+	}
+
+	client := &http.Client{Timeout: (pollTimeoutSeconds + 10) * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch updates: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	var result getUpdatesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("could not decode getUpdates response: %w", err)
+	}
+	if !result.OK {
+		return nil, fmt.Errorf("telegram getUpdates returned ok=false")
+	}
+
+	return result.Result, nil
+}
+
+// deleteWebhook clears any webhook registered for the bot; Telegram refuses
+// to serve getUpdates while a webhook is still active.
+func deleteWebhook(botToken string) error {
+	apiURL := fmt.Sprintf("https://api.telegram.org/bot%s/deleteWebhook", botToken)
+
+	resp, err := http.Post(apiURL, "application/json", nil)
+	if err != nil {
+		return fmt.Errorf("could not call deleteWebhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	log.Println("[SUCCESS] Webhook deleted, ready for long polling.")
+	return nil
+}